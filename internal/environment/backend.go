@@ -0,0 +1,57 @@
+package environment
+
+import (
+	"context"
+	"io"
+	"os/exec"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Backend is the set of container operations an Environment needs. The
+// default Backend talks to the local Docker socket; other implementations
+// let sail run against Podman, containerd/nerdctl, or a remote Docker daemon
+// reached over SSH.
+type Backend interface {
+	// Inspect returns the container's metadata, or ErrMissingContainer if it
+	// does not exist.
+	Inspect(ctx context.Context, name string) (types.ContainerJSON, error)
+	Start(ctx context.Context, name string) error
+	Stop(ctx context.Context, name string) error
+	Remove(ctx context.Context, name string) error
+
+	// Exec returns a command that runs cmd inside the named container. The
+	// caller decides whether to run it attached to a TTY.
+	Exec(ctx context.Context, name string, tty bool, cmd string, args ...string) *exec.Cmd
+
+	// CopyFrom streams path out of the named container as a tar archive.
+	CopyFrom(ctx context.Context, name, path string) (io.ReadCloser, error)
+	// CopyTo streams a tar archive into destPath inside the named container.
+	CopyTo(ctx context.Context, name, destPath string, content io.Reader) error
+
+	// Build builds an image from a build context tar archive.
+	Build(ctx context.Context, opts BuildOptions) error
+
+	// Commit snapshots the named container's filesystem into a new image
+	// tagged ref and returns the resulting image id.
+	Commit(ctx context.Context, name, ref string) (string, error)
+	// Recreate replaces the named container with a new one started from
+	// image, reusing cnt's mounts and config so volumes survive the swap.
+	Recreate(ctx context.Context, name, image string, cnt types.ContainerJSON) error
+}
+
+// BuildOptions describes an image build.
+type BuildOptions struct {
+	// Context is a tar archive of the build context.
+	Context io.Reader
+	// Dockerfile is the path to the Dockerfile within Context.
+	Dockerfile string
+	// Tags are the names to tag the built image with.
+	Tags []string
+}
+
+// DefaultBackend returns the Backend sail uses unless configured otherwise:
+// the local Docker daemon over its Unix socket.
+func DefaultBackend() Backend {
+	return dockerBackend{}
+}
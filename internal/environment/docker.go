@@ -0,0 +1,216 @@
+package environment
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"golang.org/x/xerrors"
+)
+
+// dockerBackend talks to a Docker daemon, shelling out to the docker CLI for
+// Exec since that's what gives us a transparent TTY. dial defaults to
+// dockerClient, which connects to the local socket; NewRemoteBackend
+// overrides it to reach a daemon over SSH instead.
+type dockerBackend struct {
+	dial func() *client.Client
+	// host, if set, is passed to the docker CLI as -H for Exec so it talks
+	// to the same daemon as dial.
+	host string
+}
+
+func (b dockerBackend) client() *client.Client {
+	if b.dial != nil {
+		return b.dial()
+	}
+	return dockerClient()
+}
+
+func (b dockerBackend) Inspect(ctx context.Context, name string) (types.ContainerJSON, error) {
+	cli := b.client()
+	defer cli.Close()
+
+	cnt, err := cli.ContainerInspect(ctx, name)
+	if isContainerNotFoundError(err) {
+		return types.ContainerJSON{}, ErrMissingContainer
+	}
+	if err != nil {
+		return types.ContainerJSON{}, xerrors.Errorf("failed to inspect container: %w", err)
+	}
+
+	return cnt, nil
+}
+
+func (b dockerBackend) Start(ctx context.Context, name string) error {
+	cli := b.client()
+	defer cli.Close()
+
+	err := cli.ContainerStart(ctx, name, types.ContainerStartOptions{})
+	if err != nil {
+		return xerrors.Errorf("failed to start container: %w", err)
+	}
+
+	return nil
+}
+
+func (b dockerBackend) Stop(ctx context.Context, name string) error {
+	cli := b.client()
+	defer cli.Close()
+
+	err := cli.ContainerStop(ctx, name, nil)
+	if err != nil {
+		return xerrors.Errorf("failed to stop container: %w", err)
+	}
+
+	return nil
+}
+
+func (b dockerBackend) Remove(ctx context.Context, name string) error {
+	cli := b.client()
+	defer cli.Close()
+
+	err := cli.ContainerRemove(ctx, name, types.ContainerRemoveOptions{})
+	if err != nil {
+		return xerrors.Errorf("failed to remove container: %w", err)
+	}
+
+	return nil
+}
+
+func (b dockerBackend) Exec(ctx context.Context, name string, tty bool, cmd string, args ...string) *exec.Cmd {
+	flags := "-i"
+	if tty {
+		flags = "-it"
+	}
+	args = append([]string{"exec", flags, name, cmd}, args...)
+	if b.host != "" {
+		args = append([]string{"-H", b.host}, args...)
+	}
+	return exec.CommandContext(ctx, "docker", args...)
+}
+
+func (b dockerBackend) CopyFrom(ctx context.Context, name, path string) (io.ReadCloser, error) {
+	cli := b.client()
+	defer cli.Close()
+
+	rdr, _, err := cli.CopyFromContainer(ctx, name, path)
+	if isPathNotFound(err) {
+		return nil, errNoSuchFile
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get reader for path '%s': %w", path, err)
+	}
+
+	return rdr, nil
+}
+
+func (b dockerBackend) CopyTo(ctx context.Context, name, destPath string, content io.Reader) error {
+	cli := b.client()
+	defer cli.Close()
+
+	err := cli.CopyToContainer(ctx, name, destPath, content, types.CopyToContainerOptions{})
+	if err != nil {
+		return xerrors.Errorf("failed to copy to container: %w", err)
+	}
+
+	return nil
+}
+
+func (b dockerBackend) Build(ctx context.Context, opts BuildOptions) error {
+	cli := b.client()
+	defer cli.Close()
+
+	resp, err := cli.ImageBuild(ctx, opts.Context, types.ImageBuildOptions{
+		Dockerfile: opts.Dockerfile,
+		Tags:       opts.Tags,
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to build image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The build API returns 200 and a chunked JSON message stream even when
+	// a build step fails; a failed step only shows up as an "error" message
+	// within that stream, so it has to be decoded rather than discarded.
+	err = jsonmessage.DisplayJSONMessagesStream(resp.Body, io.Discard, 0, false, nil)
+	if err != nil {
+		return xerrors.Errorf("failed to build image: %w", err)
+	}
+
+	return nil
+}
+
+func (b dockerBackend) Commit(ctx context.Context, name, ref string) (string, error) {
+	cli := b.client()
+	defer cli.Close()
+
+	resp, err := cli.ContainerCommit(ctx, name, types.ContainerCommitOptions{Reference: ref})
+	if err != nil {
+		return "", xerrors.Errorf("failed to commit container: %w", err)
+	}
+
+	return resp.ID, nil
+}
+
+// Recreate swaps name's container for a new one started from image. It
+// renames the existing container out of the way first and only removes it
+// once the replacement is created and started, so a failed create/start
+// leaves the original container intact under its original name rather than
+// the environment losing its container entirely.
+func (b dockerBackend) Recreate(ctx context.Context, name, image string, cnt types.ContainerJSON) error {
+	cli := b.client()
+	defer cli.Close()
+
+	tmpName := name + "-snapshot-restore"
+	err := cli.ContainerRename(ctx, name, tmpName)
+	if err != nil {
+		return xerrors.Errorf("failed to rename container out of the way: %w", err)
+	}
+
+	cfg := cnt.Config
+	cfg.Image = image
+
+	_, err = cli.ContainerCreate(ctx, cfg, cnt.HostConfig, &network.NetworkingConfig{}, nil, name)
+	if err != nil {
+		if renameErr := cli.ContainerRename(ctx, tmpName, name); renameErr != nil {
+			return xerrors.Errorf("failed to create container from '%s': %w (and failed to restore original: %s)", image, err, renameErr)
+		}
+		return xerrors.Errorf("failed to create container from '%s': %w", image, err)
+	}
+
+	err = cli.ContainerStart(ctx, name, types.ContainerStartOptions{})
+	if err != nil {
+		removeErr := cli.ContainerRemove(ctx, name, types.ContainerRemoveOptions{Force: true})
+		renameErr := cli.ContainerRename(ctx, tmpName, name)
+		if removeErr != nil || renameErr != nil {
+			return xerrors.Errorf("failed to start container: %w (cleanup also failed: remove=%v rename=%v)", err, removeErr, renameErr)
+		}
+		return xerrors.Errorf("failed to start container: %w", err)
+	}
+
+	err = cli.ContainerRemove(ctx, tmpName, types.ContainerRemoveOptions{Force: true})
+	if err != nil {
+		return xerrors.Errorf("failed to remove old container '%s': %w", tmpName, err)
+	}
+
+	return nil
+}
+
+func isPathNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "No such container:path")
+}
+
+func isContainerNotFoundError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "No such container")
+}
@@ -5,38 +5,36 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"golang.org/x/xerrors"
 )
 
 type Environment struct {
-	name string
-	cnt  types.ContainerJSON
+	name    string
+	cnt     types.ContainerJSON
+	backend Backend
 }
 
 var ErrMissingContainer = xerrors.Errorf("missing container")
 
-// FindEnvironment tries to find a container for an environment, returning
-// ErrMissingContainer if not found.
-func FindEnvironment(ctx context.Context, name string) (*Environment, error) {
-	cli := dockerClient()
-	defer cli.Close()
-
-	cnt, err := cli.ContainerInspect(ctx, name)
-	if isContainerNotFoundError(err) {
-		return nil, ErrMissingContainer
-	}
+// FindEnvironment tries to find a container for an environment on backend,
+// returning ErrMissingContainer if not found.
+func FindEnvironment(ctx context.Context, backend Backend, name string) (*Environment, error) {
+	cnt, err := backend.Inspect(ctx, name)
 	if err != nil {
-		return nil, xerrors.Errorf("failed to inspect container: %w", err)
+		return nil, err
 	}
 
 	env := &Environment{
-		name: name,
-		cnt:  cnt,
+		name:    name,
+		cnt:     cnt,
+		backend: backend,
 	}
 
 	// Start it up.
@@ -49,39 +47,15 @@ func FindEnvironment(ctx context.Context, name string) (*Environment, error) {
 }
 
 func Start(ctx context.Context, env *Environment) error {
-	cli := dockerClient()
-	defer cli.Close()
-
-	err := cli.ContainerStart(ctx, env.name, types.ContainerStartOptions{})
-	if err != nil {
-		return xerrors.Errorf("failed to start container: %w", err)
-	}
-
-	return nil
+	return env.backend.Start(ctx, env.name)
 }
 
 func Stop(ctx context.Context, env *Environment) error {
-	cli := dockerClient()
-	defer cli.Close()
-
-	err := cli.ContainerStop(ctx, env.name, nil)
-	if err != nil {
-		return xerrors.Errorf("failed to stop container: %w", err)
-	}
-
-	return nil
+	return env.backend.Stop(ctx, env.name)
 }
 
 func Remove(ctx context.Context, env *Environment) error {
-	cli := dockerClient()
-	defer cli.Close()
-
-	err := cli.ContainerRemove(ctx, env.name, types.ContainerRemoveOptions{})
-	if err != nil {
-		return xerrors.Errorf("failed to remove container: %w", err)
-	}
-
-	return nil
+	return env.backend.Remove(ctx, env.name)
 }
 
 func Purge(ctx context.Context, env *Environment) error {
@@ -98,82 +72,180 @@ func Purge(ctx context.Context, env *Environment) error {
 }
 
 func (e *Environment) Exec(ctx context.Context, cmd string, args ...string) *exec.Cmd {
-	args = append([]string{"exec", "-i", e.name, cmd}, args...)
-	return exec.CommandContext(ctx, "docker", args...)
+	return e.backend.Exec(ctx, e.name, false, cmd, args...)
 }
 
 func (e *Environment) ExecTTY(ctx context.Context, cmd string, args ...string) *exec.Cmd {
-	args = append([]string{"exec", "-it", e.name, cmd}, args...)
-	return exec.CommandContext(ctx, "docker", args...)
+	return e.backend.Exec(ctx, e.name, true, cmd, args...)
 }
 
-var errNoSuchFile = xerrors.Errorf("no such file")
-
-// readPath reads a path inside the environment. The returned reader is suitable
-// for use with a tar reader.
-//
-// The root of the tar archive will be '.'
-// E.g. if path is '/tmp/somedir', a file exists at '/tmp/somedir/file', the tar
-// header name will be 'file'.
-func (e *Environment) readPath(ctx context.Context, path string) (io.Reader, error) {
-	cli := dockerClient()
-	defer cli.Close()
+// FileEntry is a single file to be written into an environment by WritePath.
+type FileEntry struct {
+	Name    string
+	Mode    int64
+	ModTime time.Time
+	Body    []byte
+}
 
-	rdr, _, err := cli.CopyFromContainer(ctx, e.name, path)
-	if isPathNotFound(err) {
-		return nil, errNoSuchFile
+// WritePath writes files into the environment at destPath by streaming them
+// into the container as a tar archive via the backend's CopyTo.
+// destPath must already exist and be a directory.
+func (e *Environment) WritePath(ctx context.Context, destPath string, files ...FileEntry) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    f.Name,
+			Mode:    f.Mode,
+			Size:    int64(len(f.Body)),
+			ModTime: f.ModTime,
+		}
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			return xerrors.Errorf("failed to write header for '%s': %w", f.Name, err)
+		}
+		_, err = tw.Write(f.Body)
+		if err != nil {
+			return xerrors.Errorf("failed to write body for '%s': %w", f.Name, err)
+		}
 	}
+	err := tw.Close()
 	if err != nil {
-		return nil, xerrors.Errorf("failed to get reader for path '%s': %w", path, err)
+		return xerrors.Errorf("failed to close tar writer: %w", err)
+	}
+
+	err = e.backend.CopyTo(ctx, e.name, destPath, &buf)
+	if err != nil {
+		return err
 	}
-	defer rdr.Close()
 
-	var (
-		buf bytes.Buffer
+	return nil
+}
 
-		base = filepath.Base(path)
+// CopyDir recursively copies the contents of the host directory srcPath into
+// destPath inside the environment.
+func (e *Environment) CopyDir(ctx context.Context, destPath, srcPath string) error {
+	var files []FileEntry
 
-		tr = tar.NewReader(rdr)
-		tw = tar.NewWriter(&buf)
-	)
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
+	err := filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			return nil, xerrors.Errorf("failed to read from tar reader: %w", err)
+			return err
+		}
+		if info.IsDir() {
+			return nil
 		}
 
-		hdr.Name = strings.TrimLeft(hdr.Name, base+"/")
-		err = tw.WriteHeader(hdr)
+		rel, err := filepath.Rel(srcPath, path)
 		if err != nil {
-			return nil, xerrors.Errorf("failed to write header: %w", err)
+			return xerrors.Errorf("failed to compute relative path for '%s': %w", path, err)
 		}
 
-		_, err = io.Copy(tw, tr)
+		body, err := os.ReadFile(path)
 		if err != nil {
-			return nil, xerrors.Errorf("failed to copy: %w", err)
+			return xerrors.Errorf("failed to read '%s': %w", path, err)
 		}
-	}
-	err = tw.Close()
+
+		files = append(files, FileEntry{
+			Name:    filepath.ToSlash(rel),
+			Mode:    int64(info.Mode().Perm()),
+			ModTime: info.ModTime(),
+			Body:    body,
+		})
+		return nil
+	})
 	if err != nil {
-		return nil, xerrors.Errorf("failed to close tar writer: %w", err)
+		return xerrors.Errorf("failed to walk '%s': %w", srcPath, err)
 	}
 
-	return &buf, nil
+	return e.WritePath(ctx, destPath, files...)
 }
 
-func isPathNotFound(err error) bool {
-	if err == nil {
-		return false
+var errNoSuchFile = xerrors.Errorf("no such file")
+
+// ReadPath reads a path inside the environment and streams it back as a tar
+// archive, preserving each entry's mode, uid/gid and xattrs (PAX records)
+// exactly as the backend reported them.
+//
+// The root of the tar archive will be '.'
+// E.g. if path is '/tmp/somedir', a file exists at '/tmp/somedir/file', the tar
+// header name will be 'file'.
+//
+// The archive is produced by a goroutine writing into an io.Pipe, so large
+// directories are streamed rather than buffered in memory.
+func (e *Environment) ReadPath(ctx context.Context, path string) (io.ReadCloser, error) {
+	rdr, err := e.backend.CopyFrom(ctx, e.name, path)
+	if err != nil {
+		return nil, err
 	}
-	return strings.Contains(err.Error(), "No such container:path")
+
+	base := filepath.Base(path)
+	pr, pw := io.Pipe()
+
+	go func() {
+		defer rdr.Close()
+
+		tr := tar.NewReader(rdr)
+		tw := tar.NewWriter(pw)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				pw.CloseWithError(xerrors.Errorf("failed to read from tar reader: %w", err))
+				return
+			}
+
+			hdr.Name = strings.TrimPrefix(hdr.Name, base+"/")
+			err = tw.WriteHeader(hdr)
+			if err != nil {
+				pw.CloseWithError(xerrors.Errorf("failed to write header: %w", err))
+				return
+			}
+
+			_, err = io.Copy(tw, tr)
+			if err != nil {
+				pw.CloseWithError(xerrors.Errorf("failed to copy: %w", err))
+				return
+			}
+		}
+
+		err = tw.Close()
+		if err != nil {
+			pw.CloseWithError(xerrors.Errorf("failed to close tar writer: %w", err))
+			return
+		}
+		pw.Close()
+	}()
+
+	return pr, nil
 }
 
-func isContainerNotFoundError(err error) bool {
-	if err == nil {
-		return false
+// ReadFile reads a single file at path inside the environment and returns
+// its contents. path must name a regular file, not a directory.
+func (e *Environment) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	rdr, err := e.ReadPath(ctx, path)
+	if err != nil {
+		return nil, err
 	}
-	return strings.Contains(err.Error(), "No such container")
+	defer rdr.Close()
+
+	tr := tar.NewReader(rdr)
+	hdr, err := tr.Next()
+	if err == io.EOF {
+		return nil, errNoSuchFile
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read from tar reader: %w", err)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil, xerrors.Errorf("'%s' is not a regular file", path)
+	}
+
+	body, err := io.ReadAll(tr)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read '%s': %w", path, err)
+	}
+
+	return body, nil
 }
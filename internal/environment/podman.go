@@ -0,0 +1,203 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"golang.org/x/xerrors"
+)
+
+// podmanBackend drives a rootless or rootful Podman instance through the
+// podman CLI. Podman keeps its inspect output close to Docker's API shape,
+// so we decode straight into types.ContainerJSON; CopyFrom/CopyTo shell out
+// to `podman cp`, which (like `docker cp`) accepts "-" to stream a tar
+// through stdin/stdout.
+type podmanBackend struct{}
+
+// NewPodmanBackend returns a Backend that talks to Podman instead of Docker.
+func NewPodmanBackend() Backend {
+	return podmanBackend{}
+}
+
+func (podmanBackend) Inspect(ctx context.Context, name string) (types.ContainerJSON, error) {
+	cmd := exec.CommandContext(ctx, "podman", "inspect", "--type", "container", name)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if isPodmanNotFound(stderr.String()) {
+			return types.ContainerJSON{}, ErrMissingContainer
+		}
+		return types.ContainerJSON{}, xerrors.Errorf("failed to inspect container: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	var cnts []types.ContainerJSON
+	err = json.Unmarshal(out, &cnts)
+	if err != nil {
+		return types.ContainerJSON{}, xerrors.Errorf("failed to decode podman inspect output: %w", err)
+	}
+	if len(cnts) == 0 {
+		return types.ContainerJSON{}, ErrMissingContainer
+	}
+
+	return cnts[0], nil
+}
+
+func (podmanBackend) Start(ctx context.Context, name string) error {
+	err := exec.CommandContext(ctx, "podman", "start", name).Run()
+	if err != nil {
+		return xerrors.Errorf("failed to start container: %w", err)
+	}
+	return nil
+}
+
+func (podmanBackend) Stop(ctx context.Context, name string) error {
+	err := exec.CommandContext(ctx, "podman", "stop", name).Run()
+	if err != nil {
+		return xerrors.Errorf("failed to stop container: %w", err)
+	}
+	return nil
+}
+
+func (podmanBackend) Remove(ctx context.Context, name string) error {
+	err := exec.CommandContext(ctx, "podman", "rm", name).Run()
+	if err != nil {
+		return xerrors.Errorf("failed to remove container: %w", err)
+	}
+	return nil
+}
+
+func (podmanBackend) Exec(ctx context.Context, name string, tty bool, cmd string, args ...string) *exec.Cmd {
+	flags := "-i"
+	if tty {
+		flags = "-it"
+	}
+	args = append([]string{"exec", flags, name, cmd}, args...)
+	return exec.CommandContext(ctx, "podman", args...)
+}
+
+func (podmanBackend) CopyFrom(ctx context.Context, name, path string) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, "podman", "cp", name+":"+path, "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	rdr, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open stdout pipe: %w", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get reader for path '%s': %w", path, err)
+	}
+
+	return &cmdReadCloser{ReadCloser: rdr, cmd: cmd, stderr: &stderr, path: path}, nil
+}
+
+func (podmanBackend) CopyTo(ctx context.Context, name, destPath string, content io.Reader) error {
+	cmd := exec.CommandContext(ctx, "podman", "cp", "-", name+":"+destPath)
+	cmd.Stdin = content
+	err := cmd.Run()
+	if err != nil {
+		return xerrors.Errorf("failed to copy to container: %w", err)
+	}
+	return nil
+}
+
+func (podmanBackend) Build(ctx context.Context, opts BuildOptions) error {
+	args := []string{"build"}
+	if opts.Dockerfile != "" {
+		args = append(args, "-f", opts.Dockerfile)
+	}
+	for _, tag := range opts.Tags {
+		args = append(args, "-t", tag)
+	}
+	args = append(args, "-")
+
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	cmd.Stdin = opts.Context
+	err := cmd.Run()
+	if err != nil {
+		return xerrors.Errorf("failed to build image: %w", err)
+	}
+	return nil
+}
+
+func (podmanBackend) Commit(ctx context.Context, name, ref string) (string, error) {
+	out, err := exec.CommandContext(ctx, "podman", "commit", name, ref).Output()
+	if err != nil {
+		return "", xerrors.Errorf("failed to commit container: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (podmanBackend) Recreate(ctx context.Context, name, image string, cnt types.ContainerJSON) error {
+	// podman container clone can swap the image of an existing container
+	// while carrying over its mounts, so we clone under a temp name, drop
+	// the old container, then rename the clone back into place.
+	tmpName := name + "-snapshot-restore"
+
+	err := exec.CommandContext(ctx, "podman", "container", "clone", "--name", tmpName, "--image", image, name).Run()
+	if err != nil {
+		return xerrors.Errorf("failed to clone container onto '%s': %w", image, err)
+	}
+
+	err = exec.CommandContext(ctx, "podman", "rm", "-f", name).Run()
+	if err != nil {
+		return xerrors.Errorf("failed to remove container: %w", err)
+	}
+
+	err = exec.CommandContext(ctx, "podman", "rename", tmpName, name).Run()
+	if err != nil {
+		return xerrors.Errorf("failed to rename clone into place: %w", err)
+	}
+
+	err = exec.CommandContext(ctx, "podman", "start", name).Run()
+	if err != nil {
+		return xerrors.Errorf("failed to start container: %w", err)
+	}
+
+	return nil
+}
+
+// cmdReadCloser closes the command's stdout pipe and waits on the process
+// when the caller is done reading. podman cp only reports a missing path by
+// exiting non-zero, so Close inspects the captured stderr to translate that
+// into the shared errNoSuchFile sentinel.
+type cmdReadCloser struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	path   string
+}
+
+func (c *cmdReadCloser) Close() error {
+	err := c.ReadCloser.Close()
+	waitErr := c.cmd.Wait()
+	if waitErr != nil {
+		if isPodmanNoSuchFile(c.stderr.String()) {
+			return errNoSuchFile
+		}
+		return xerrors.Errorf("failed to get reader for path '%s': %s: %w", c.path, strings.TrimSpace(c.stderr.String()), waitErr)
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func isPodmanNotFound(stderr string) bool {
+	stderr = strings.ToLower(stderr)
+	return strings.Contains(stderr, "no such container") || strings.Contains(stderr, "no such object")
+}
+
+func isPodmanNoSuchFile(stderr string) bool {
+	stderr = strings.ToLower(stderr)
+	return strings.Contains(stderr, "no such file or directory") || strings.Contains(stderr, "no such container:path")
+}
@@ -0,0 +1,34 @@
+package environment
+
+import (
+	"net/http"
+
+	"github.com/docker/cli/cli/connhelper"
+	"github.com/docker/docker/client"
+	"golang.org/x/xerrors"
+)
+
+// NewRemoteBackend returns a Backend that talks to a Docker daemon on a
+// remote host reached over SSH, e.g. "ssh://user@host". It dials through
+// Docker CLI's connhelper, the same helper `docker -H ssh://...` uses, so
+// any host reachable by plain `ssh` works without exposing a TCP port.
+func NewRemoteBackend(host string) (Backend, error) {
+	helper, err := connhelper.GetConnectionHelper(host)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to resolve connection helper for '%s': %w", host, err)
+	}
+
+	cli, err := client.NewClientWithOpts(
+		client.WithHost(helper.Host),
+		client.WithHTTPClient(&http.Client{Transport: &http.Transport{DialContext: helper.Dialer}}),
+		client.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to dial '%s': %w", host, err)
+	}
+
+	return dockerBackend{
+		host: host,
+		dial: func() *client.Client { return cli },
+	}, nil
+}
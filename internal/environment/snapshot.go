@@ -0,0 +1,185 @@
+package environment
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// SnapshotID identifies an image produced by Environment.Snapshot. It's the
+// id of the committed image, so it can be fed straight back into the
+// backend (e.g. as the image for Restore, or to diff two layers).
+type SnapshotID string
+
+// Snapshot is one entry in an environment's lineage: a bookmark of a known
+// state that Restore can return to.
+type Snapshot struct {
+	ID        SnapshotID
+	ParentID  SnapshotID // empty for the first snapshot of an environment
+	Label     string
+	Author    string
+	CreatedAt time.Time
+}
+
+// lineage is the sidecar recording an environment's snapshot history and
+// which snapshot it's currently running from, so a Snapshot taken after a
+// Restore gets parented under the restored state rather than whatever was
+// last appended to the list.
+type lineage struct {
+	Snapshots []Snapshot
+	Current   SnapshotID
+}
+
+// Snapshot commits the environment's current filesystem into a new image
+// and records it, labeled, in the environment's lineage sidecar so it can
+// later be listed or restored with Restore.
+func (e *Environment) Snapshot(ctx context.Context, label string) (SnapshotID, error) {
+	lin, err := loadLineage(e.name)
+	if err != nil {
+		return "", err
+	}
+
+	ref := "sail-snapshot/" + e.name + ":" + label
+	imageID, err := e.backend.Commit(ctx, e.name, ref)
+	if err != nil {
+		return "", xerrors.Errorf("failed to commit environment: %w", err)
+	}
+
+	snap := Snapshot{
+		ID:        SnapshotID(imageID),
+		ParentID:  lin.Current,
+		Label:     label,
+		Author:    currentUser(),
+		CreatedAt: time.Now(),
+	}
+
+	lin.Snapshots = append(lin.Snapshots, snap)
+	lin.Current = snap.ID
+
+	err = saveLineage(e.name, lin)
+	if err != nil {
+		return "", err
+	}
+
+	return snap.ID, nil
+}
+
+// Snapshots returns the environment's lineage, oldest first.
+func (e *Environment) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	lin, err := loadLineage(e.name)
+	if err != nil {
+		return nil, err
+	}
+	return lin.Snapshots, nil
+}
+
+var errUnknownSnapshot = xerrors.Errorf("unknown snapshot")
+
+// Restore re-creates the environment's container from a previously committed
+// snapshot, preserving the volumes mounted into the current container, and
+// records the snapshot as the environment's current state so a later
+// Snapshot is parented under it rather than under whatever was taken last.
+func (e *Environment) Restore(ctx context.Context, id SnapshotID) error {
+	lin, err := loadLineage(e.name)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, snap := range lin.Snapshots {
+		if snap.ID == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errUnknownSnapshot
+	}
+
+	err = e.backend.Recreate(ctx, e.name, string(id), e.cnt)
+	if err != nil {
+		return xerrors.Errorf("failed to restore snapshot '%s': %w", id, err)
+	}
+
+	lin.Current = id
+	err = saveLineage(e.name, lin)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func currentUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
+
+// userConfigDir is a seam over os.UserConfigDir so tests can point the
+// lineage sidecar at a temp directory instead of the real user config dir.
+var userConfigDir = os.UserConfigDir
+
+// snapshotsPath is where an environment's lineage is recorded, e.g.
+// ~/.config/sail/snapshots/<name>.json.
+func snapshotsPath(name string) (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", xerrors.Errorf("failed to find config dir: %w", err)
+	}
+	return filepath.Join(dir, "sail", "snapshots", name+".json"), nil
+}
+
+func loadLineage(name string) (lineage, error) {
+	path, err := snapshotsPath(name)
+	if err != nil {
+		return lineage{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lineage{}, nil
+	}
+	if err != nil {
+		return lineage{}, xerrors.Errorf("failed to read '%s': %w", path, err)
+	}
+
+	var lin lineage
+	err = json.Unmarshal(data, &lin)
+	if err != nil {
+		return lineage{}, xerrors.Errorf("failed to decode '%s': %w", path, err)
+	}
+
+	return lin, nil
+}
+
+func saveLineage(name string, lin lineage) error {
+	path, err := snapshotsPath(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return xerrors.Errorf("failed to create '%s': %w", filepath.Dir(path), err)
+	}
+
+	data, err := json.MarshalIndent(lin, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("failed to encode snapshots: %w", err)
+	}
+
+	err = os.WriteFile(path, data, 0o644)
+	if err != nil {
+		return xerrors.Errorf("failed to write '%s': %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package environment
+
+import (
+	"context"
+	"testing"
+)
+
+// withTempConfigDir points userConfigDir at a fresh temp directory for the
+// duration of the test, so lineage sidecars don't touch the real user config
+// dir (or collide between tests).
+func withTempConfigDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	prev := userConfigDir
+	userConfigDir = func() (string, error) { return dir, nil }
+	t.Cleanup(func() { userConfigDir = prev })
+}
+
+// TestSnapshotParentIDFollowsRestore guards against the regression where a
+// snapshot taken after a Restore was parented under whatever was last
+// appended to the lineage instead of the snapshot actually restored to.
+func TestSnapshotParentIDFollowsRestore(t *testing.T) {
+	withTempConfigDir(t)
+	ctx := context.Background()
+	env := &Environment{name: "test", backend: newFakeBackend()}
+
+	idA, err := env.Snapshot(ctx, "a")
+	if err != nil {
+		t.Fatalf("Snapshot a: %v", err)
+	}
+	_, err = env.Snapshot(ctx, "b")
+	if err != nil {
+		t.Fatalf("Snapshot b: %v", err)
+	}
+
+	err = env.Restore(ctx, idA)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	idC, err := env.Snapshot(ctx, "c")
+	if err != nil {
+		t.Fatalf("Snapshot c: %v", err)
+	}
+
+	snaps, err := env.Snapshots(ctx)
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+
+	var c *Snapshot
+	for i := range snaps {
+		if snaps[i].ID == idC {
+			c = &snaps[i]
+		}
+	}
+	if c == nil {
+		t.Fatalf("snapshot 'c' (%s) not found in lineage: %+v", idC, snaps)
+	}
+	if c.ParentID != idA {
+		t.Fatalf("expected snapshot 'c' to be parented under restored snapshot %s, got %s", idA, c.ParentID)
+	}
+}
+
+// TestRestoreFailureLeavesLineageIntact guards against a failed Restore
+// corrupting the lineage sidecar: if the backend can't recreate the
+// container, the environment's recorded "current" snapshot must stay
+// whatever it was before the attempt.
+func TestRestoreFailureLeavesLineageIntact(t *testing.T) {
+	withTempConfigDir(t)
+	ctx := context.Background()
+	backend := newFakeBackend()
+	env := &Environment{name: "test", backend: backend}
+
+	idA, err := env.Snapshot(ctx, "a")
+	if err != nil {
+		t.Fatalf("Snapshot a: %v", err)
+	}
+	idB, err := env.Snapshot(ctx, "b")
+	if err != nil {
+		t.Fatalf("Snapshot b: %v", err)
+	}
+
+	backend.recreateErr = errUnknownSnapshot // any non-nil error stands in for a failed swap
+	err = env.Restore(ctx, idA)
+	if err == nil {
+		t.Fatal("expected Restore to fail")
+	}
+
+	lin, err := loadLineage(env.name)
+	if err != nil {
+		t.Fatalf("loadLineage: %v", err)
+	}
+	if lin.Current != idB {
+		t.Fatalf("expected lineage to still point at %s after failed restore, got %s", idB, lin.Current)
+	}
+}
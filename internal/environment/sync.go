@@ -0,0 +1,232 @@
+package environment
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/xerrors"
+)
+
+// ChangeKind describes how a path differs between the host and the
+// environment.
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeModified
+	ChangeDeleted
+)
+
+// Change is a single difference found by diffing a host directory against
+// the matching directory inside an environment.
+type Change struct {
+	Path string
+	Kind ChangeKind
+}
+
+// SyncOptions controls how Sync reconciles a host directory with a directory
+// inside an environment.
+type SyncOptions struct {
+	// Delete makes Sync remove files from the container that no longer exist
+	// on the host.
+	Delete bool
+	// DebounceInterval is the quiet period Watch waits for after an fsnotify
+	// event before it syncs, to coalesce bursts of writes. Defaults to
+	// 200ms if zero.
+	DebounceInterval time.Duration
+}
+
+// Sync reconciles containerPath inside the environment with hostDir,
+// pushing only the files that changed. It compares mtime and size, the same
+// heuristic Docker's archive.ChangesDirs uses, so unchanged files are never
+// re-sent.
+func (e *Environment) Sync(ctx context.Context, hostDir, containerPath string, opts SyncOptions) ([]Change, error) {
+	remote, err := e.statContainerTree(ctx, containerPath)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to stat container tree: %w", err)
+	}
+
+	var (
+		changes []Change
+		files   []FileEntry
+		seen    = make(map[string]bool, len(remote))
+	)
+
+	err = filepath.Walk(hostDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(hostDir, path)
+		if err != nil {
+			return xerrors.Errorf("failed to compute relative path for '%s': %w", path, err)
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+
+		prev, ok := remote[rel]
+		// tar only has second-resolution mtimes (tar.Writer rounds to the
+		// nearest second), so round the host's mtime the same way before
+		// comparing or every file looks modified on the very next Sync.
+		if ok && prev.size == info.Size() && prev.modTime.Equal(info.ModTime().Round(time.Second)) {
+			return nil
+		}
+
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return xerrors.Errorf("failed to read '%s': %w", path, err)
+		}
+		files = append(files, FileEntry{
+			Name:    rel,
+			Mode:    int64(info.Mode().Perm()),
+			ModTime: info.ModTime(),
+			Body:    body,
+		})
+
+		kind := ChangeAdded
+		if ok {
+			kind = ChangeModified
+		}
+		changes = append(changes, Change{Path: rel, Kind: kind})
+
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to walk '%s': %w", hostDir, err)
+	}
+
+	if len(files) > 0 {
+		err = e.WritePath(ctx, containerPath, files...)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to push changed files: %w", err)
+		}
+	}
+
+	if opts.Delete {
+		for rel := range remote {
+			if seen[rel] {
+				continue
+			}
+			changes = append(changes, Change{Path: rel, Kind: ChangeDeleted})
+
+			err = e.Exec(ctx, "rm", "-f", path.Join(containerPath, rel)).Run()
+			if err != nil {
+				return nil, xerrors.Errorf("failed to delete '%s' in container: %w", rel, err)
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+type remoteFileInfo struct {
+	size    int64
+	modTime time.Time
+}
+
+// statContainerTree reads containerPath as a tar stream and returns the
+// size/mtime of every regular file it contains, keyed by path relative to
+// containerPath.
+func (e *Environment) statContainerTree(ctx context.Context, containerPath string) (map[string]remoteFileInfo, error) {
+	rdr, err := e.ReadPath(ctx, containerPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+
+	out := make(map[string]remoteFileInfo)
+	tr := tar.NewReader(rdr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read from tar reader: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		out[hdr.Name] = remoteFileInfo{
+			size:    hdr.Size,
+			modTime: hdr.ModTime,
+		}
+	}
+
+	return out, nil
+}
+
+// Watch syncs hostDir into containerPath whenever a file under hostDir
+// changes, debouncing bursts of fsnotify events so e.g. a save-all doesn't
+// trigger one push per file.
+func (e *Environment) Watch(ctx context.Context, hostDir, containerPath string, opts SyncOptions) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return xerrors.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	err = filepath.Walk(hostDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to watch '%s': %w", hostDir, err)
+	}
+
+	debounce := opts.DebounceInterval
+	if debounce == 0 {
+		debounce = 200 * time.Millisecond
+	}
+
+	timer := time.NewTimer(debounce)
+	if !timer.Stop() {
+		<-timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return xerrors.Errorf("watcher error: %w", err)
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				info, err := os.Stat(ev.Name)
+				if err == nil && info.IsDir() {
+					err = watcher.Add(ev.Name)
+					if err != nil {
+						return xerrors.Errorf("failed to watch '%s': %w", ev.Name, err)
+					}
+				}
+			}
+			timer.Reset(debounce)
+		case <-timer.C:
+			_, err := e.Sync(ctx, hostDir, containerPath, opts)
+			if err != nil {
+				return xerrors.Errorf("failed to sync after watch event: %w", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package environment
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// fakeBackend simulates a container filesystem in memory, just enough to
+// exercise CopyDir/Sync without a real daemon.
+type fakeBackend struct {
+	files map[string]FileEntry // keyed by full container path
+
+	// commits counts Commit calls so each one gets a distinct image id,
+	// and recreateErr/recreateCalls let tests drive and observe Recreate
+	// without a real daemon.
+	commits       int
+	recreateErr   error
+	recreateCalls []string // images passed to Recreate, in order
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{files: make(map[string]FileEntry)}
+}
+
+func (b *fakeBackend) Inspect(ctx context.Context, name string) (types.ContainerJSON, error) {
+	return types.ContainerJSON{}, nil
+}
+func (b *fakeBackend) Start(ctx context.Context, name string) error  { return nil }
+func (b *fakeBackend) Stop(ctx context.Context, name string) error   { return nil }
+func (b *fakeBackend) Remove(ctx context.Context, name string) error { return nil }
+
+func (b *fakeBackend) Exec(ctx context.Context, name string, tty bool, cmd string, args ...string) *exec.Cmd {
+	if cmd == "rm" {
+		for _, a := range args {
+			if a == "-f" {
+				continue
+			}
+			delete(b.files, a)
+		}
+	}
+	return exec.CommandContext(ctx, "true")
+}
+
+func (b *fakeBackend) CopyFrom(ctx context.Context, name, p string) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	base := filepath.Base(p)
+	for full, f := range b.files {
+		rel, err := filepath.Rel(p, full)
+		if err != nil || rel == ".." || filepath.IsAbs(rel) {
+			continue
+		}
+		if rel == "." {
+			continue
+		}
+		hdr := &tar.Header{
+			Name:    path.Join(base, filepath.ToSlash(rel)),
+			Mode:    f.Mode,
+			Size:    int64(len(f.Body)),
+			ModTime: f.ModTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.Body); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&buf), nil
+}
+
+func (b *fakeBackend) CopyTo(ctx context.Context, name, destPath string, content io.Reader) error {
+	tr := tar.NewReader(content)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		b.files[path.Join(destPath, hdr.Name)] = FileEntry{
+			Name:    hdr.Name,
+			Mode:    hdr.Mode,
+			ModTime: hdr.ModTime,
+			Body:    body,
+		}
+	}
+	return nil
+}
+
+func (b *fakeBackend) Build(ctx context.Context, opts BuildOptions) error { return nil }
+func (b *fakeBackend) Commit(ctx context.Context, name, ref string) (string, error) {
+	b.commits++
+	return fmt.Sprintf("img%d", b.commits), nil
+}
+func (b *fakeBackend) Recreate(ctx context.Context, name, image string, cnt types.ContainerJSON) error {
+	b.recreateCalls = append(b.recreateCalls, image)
+	return b.recreateErr
+}
+
+// TestSyncConvergesAfterCopyDir guards against the mtime regression where a
+// freshly-pushed file came back with a zero ModTime, so the very next Sync
+// classified it as changed and re-pushed it forever.
+func TestSyncConvergesAfterCopyDir(t *testing.T) {
+	hostDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(hostDir, "foo.txt"), []byte("hello"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &Environment{name: "test", backend: newFakeBackend()}
+	ctx := context.Background()
+	const containerPath = "/work"
+
+	err = env.CopyDir(ctx, containerPath, hostDir)
+	if err != nil {
+		t.Fatalf("CopyDir: %v", err)
+	}
+
+	changes, err := env.Sync(ctx, hostDir, containerPath, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes after CopyDir, got %+v", changes)
+	}
+}